@@ -0,0 +1,28 @@
+package safepath
+
+import (
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// lstat returns lstat-like info for path on fsys, preferring
+// afero.Lstater.LstatIfPossible so that symlinks are reported as such
+// rather than transparently followed.
+func lstat(fsys afero.Fs, path string) (os.FileInfo, error) {
+	if lstater, ok := fsys.(afero.Lstater); ok {
+		info, _, err := lstater.LstatIfPossible(path)
+		return info, err
+	}
+	return fsys.Stat(path)
+}
+
+// readlink resolves a symlink's target on fsys, for filesystems that
+// support it.
+func readlink(fsys afero.Fs, path string) (string, error) {
+	linker, ok := fsys.(afero.LinkReader)
+	if !ok {
+		return "", os.ErrInvalid
+	}
+	return linker.ReadlinkIfPossible(path)
+}
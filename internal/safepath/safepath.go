@@ -0,0 +1,103 @@
+// Package safepath resolves an untrusted relative path against a root
+// directory the way securejoin-style libraries do: the path is walked
+// component by component, and any symlink encountered along the way is
+// expanded in place rather than handed to the OS to follow. Because every
+// intermediate result is re-anchored inside root before the next component
+// is read, neither a string of ".." segments nor a symlink pointing
+// elsewhere on the filesystem (even an absolute one, e.g. "/etc") can ever
+// produce a path outside root.
+package safepath
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// maxSymlinkExpansions caps how many symlinks Join will follow while
+// resolving a single path, guarding against symlink loops.
+const maxSymlinkExpansions = 255
+
+// Join resolves unsafePath against root on fsys and returns the result
+// joined onto root (absolute only when root is). unsafePath may contain ".." segments
+// or symlinks (including ones that are themselves absolute, or that point
+// outside root); both are clamped to stay within root rather than rejected
+// outright. Components that don't exist are treated as plain path
+// segments, since a not-yet-created path (e.g. the destination of a copy)
+// can't be a symlink.
+//
+// The final path component is never expanded even if it is itself a
+// symlink: only the parent directory chain is resolved through. This
+// matches what callers need when Join is forming a path they are about to
+// create or overwrite (a dst path under a stale symlink must name that
+// symlink, not whatever it currently points at) and is harmless for
+// read-only callers, since os.Stat/afero.Stat already follow a leaf
+// symlink on their own.
+func Join(fsys afero.Fs, root, unsafePath string) (string, error) {
+	root = filepath.Clean(root)
+
+	var currentPath string
+	remaining := filepath.ToSlash(unsafePath)
+	expansions := 0
+
+	for remaining != "" {
+		var segment string
+		if i := strings.IndexByte(remaining, '/'); i >= 0 {
+			segment, remaining = remaining[:i], remaining[i+1:]
+		} else {
+			segment, remaining = remaining, ""
+		}
+
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			currentPath = filepath.Dir(currentPath)
+			if currentPath == "." {
+				currentPath = ""
+			}
+			continue
+		}
+
+		candidate := filepath.Join(currentPath, segment)
+
+		if remaining == "" {
+			// Leaf component: never expand it, even if it's a symlink.
+			// Only the parent chain needs to be resolved for containment.
+			currentPath = candidate
+			continue
+		}
+
+		info, err := lstat(fsys, filepath.Join(root, candidate))
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			// Missing, or not a symlink: keep it as a plain segment. A
+			// missing component can't be a symlink, and anything further
+			// down this branch doesn't exist yet either.
+			currentPath = candidate
+			continue
+		}
+
+		expansions++
+		if expansions > maxSymlinkExpansions {
+			return "", fmt.Errorf("safepath: too many levels of symbolic links resolving %q", unsafePath)
+		}
+
+		target, err := readlink(fsys, filepath.Join(root, candidate))
+		if err != nil {
+			return "", fmt.Errorf("safepath: reading symlink %q: %w", candidate, err)
+		}
+		target = filepath.ToSlash(target)
+		if strings.HasPrefix(target, "/") {
+			// An absolute target is re-anchored to root rather than the
+			// real filesystem root, same as the ".." clamping above.
+			currentPath = ""
+			target = strings.TrimPrefix(target, "/")
+		}
+		remaining = filepath.ToSlash(filepath.Join(target, remaining))
+	}
+
+	return filepath.Join(root, currentPath), nil
+}
@@ -0,0 +1,95 @@
+package safepath_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"dirsync/internal/safepath"
+
+	"github.com/spf13/afero"
+)
+
+func TestJoinClampsDotDotEscape(t *testing.T) {
+	root, err := os.MkdirTemp("", "safepath-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	got, err := safepath.Join(afero.NewOsFs(), root, "../../../../etc/passwd")
+	if err != nil {
+		t.Fatalf("Join failed: %v", err)
+	}
+
+	want := filepath.Join(root, "etc/passwd")
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestJoinClampsAbsoluteSymlinkEscape(t *testing.T) {
+	root, err := os.MkdirTemp("", "safepath-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := os.Symlink("/etc", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := safepath.Join(afero.NewOsFs(), root, "link/passwd")
+	if err != nil {
+		t.Fatalf("Join failed: %v", err)
+	}
+
+	want := filepath.Join(root, "etc/passwd")
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestJoinClampsRelativeSymlinkEscape(t *testing.T) {
+	root, err := os.MkdirTemp("", "safepath-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// sub/link -> ../../../../.. , an attempt to climb out of root entirely.
+	if err := os.Symlink("../../../../..", filepath.Join(root, "sub", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := safepath.Join(afero.NewOsFs(), root, "sub/link/etc/passwd")
+	if err != nil {
+		t.Fatalf("Join failed: %v", err)
+	}
+
+	want := filepath.Join(root, "etc/passwd")
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestJoinAllowsNonExistentPath(t *testing.T) {
+	root, err := os.MkdirTemp("", "safepath-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	got, err := safepath.Join(afero.NewOsFs(), root, "new/nested/file.txt")
+	if err != nil {
+		t.Fatalf("Join failed: %v", err)
+	}
+
+	want := filepath.Join(root, "new/nested/file.txt")
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -1,12 +1,56 @@
 package main
 
 import (
+	"context"
 	"dirsync/sync"
 	"dirsync/validators"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 )
 
+// dryRunFlag supports "-dry-run" (human-readable output) and
+// "-dry-run=json" (machine-readable output), the same way a bool flag
+// supports being set without an explicit value.
+type dryRunFlag struct {
+	enabled bool
+	format  string
+}
+
+func (d *dryRunFlag) String() string {
+	return d.format
+}
+
+func (d *dryRunFlag) Set(value string) error {
+	d.enabled = true
+	d.format = value
+	if value == "true" {
+		d.format = "text"
+	}
+	return nil
+}
+
+func (d *dryRunFlag) IsBoolFlag() bool { return true }
+
+// stringSliceFlag accumulates repeated occurrences of a flag into a slice,
+// e.g. -include=a -include=b.
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
 func main() {
 	// Define flags for source, destination, and delete-missing option
 	srcDir := flag.String("src", "", "Source folder path")
@@ -16,6 +60,17 @@ func main() {
 		false,
 		"Delete files in destination that don't exist in source",
 	)
+	var includePatterns, excludePatterns stringSliceFlag
+	flag.Var(&includePatterns, "include", "Only sync paths matching this pattern (repeatable)")
+	flag.Var(&excludePatterns, "exclude", "Never sync paths matching this pattern (repeatable)")
+	watch := flag.Bool("watch", false, "Keep running and resync whenever source changes")
+	debounce := flag.Duration(
+		"debounce",
+		500*time.Millisecond,
+		"How long -watch waits after the last change before resyncing",
+	)
+	var dryRun dryRunFlag
+	flag.Var(&dryRun, "dry-run", "Print the plan instead of applying it; -dry-run=json for machine-readable output")
 	flag.Parse()
 
 	if *srcDir == "" || *dstDir == "" {
@@ -27,7 +82,48 @@ func main() {
 	if err := validators.ValidateSrcDir(*srcDir); err != nil {
 		log.Fatalf("Error validating source directory: %v", err)
 	}
-	if err := sync.Dirs(*srcDir, *dstDir, *shouldDeleteMissing); err != nil {
+
+	ignorePatterns, err := sync.LoadIgnoreFile(filepath.Join(*srcDir, ".dirsyncignore"))
+	if err != nil {
+		log.Fatalf("Error loading .dirsyncignore: %v", err)
+	}
+
+	opts := sync.Options{
+		IncludePatterns: includePatterns,
+		ExcludePatterns: append([]string(excludePatterns), ignorePatterns...),
+		DeleteMissing:   *shouldDeleteMissing,
+		Debounce:        *debounce,
+	}
+
+	if dryRun.enabled {
+		plan, err := sync.PlanDirs(*srcDir, *dstDir, opts)
+		if err != nil {
+			log.Fatalf("Error planning sync: %v", err)
+		}
+		if dryRun.format == "json" {
+			data, err := json.MarshalIndent(plan.Actions, "", "  ")
+			if err != nil {
+				log.Fatalf("Error encoding plan: %v", err)
+			}
+			fmt.Println(string(data))
+		} else {
+			fmt.Print(plan.String())
+		}
+		return
+	}
+
+	if *watch {
+		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer cancel()
+
+		log.Printf("Watching %s for changes (debounce %s)...", *srcDir, *debounce)
+		if err := sync.Watch(ctx, *srcDir, *dstDir, opts); err != nil {
+			log.Fatalf("Error watching directories: %v", err)
+		}
+		return
+	}
+
+	if err := sync.DirsWithOptions(*srcDir, *dstDir, opts); err != nil {
 		log.Fatalf("Error syncing directories: %v", err)
 	}
 	log.Println("Directory sync complete")
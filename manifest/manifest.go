@@ -0,0 +1,79 @@
+// Package manifest persists the per-file fingerprints dirsync uses to
+// decide whether a source file has actually changed, so that a content
+// hash doesn't need to be recomputed on every run.
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// FileName is the sidecar manifest's name, stored at the root of dst.
+const FileName = ".dirsync-state.json"
+
+// Entry is the last known fingerprint of a synced file, keyed by its path
+// relative to the sync root.
+type Entry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Hash    string    `json:"hash"`
+}
+
+// Manifest maps relative paths to their last known fingerprint. Get and
+// Set are safe for concurrent use, so a Manifest can be shared across the
+// worker goroutines that copy files in parallel.
+type Manifest struct {
+	mu      sync.Mutex
+	Entries map[string]Entry `json:"entries"`
+}
+
+// Load reads the manifest from dir on fsys. A missing manifest is not an
+// error; it yields an empty Manifest ready to populate.
+func Load(fsys afero.Fs, dir string) (*Manifest, error) {
+	data, err := afero.ReadFile(fsys, filepath.Join(dir, FileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Manifest{Entries: make(map[string]Entry)}, nil
+		}
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+	if m.Entries == nil {
+		m.Entries = make(map[string]Entry)
+	}
+	return &m, nil
+}
+
+// Save writes the manifest to dir on fsys.
+func (m *Manifest) Save(fsys afero.Fs, dir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+	return afero.WriteFile(fsys, filepath.Join(dir, FileName), data, 0o644)
+}
+
+// Get returns the recorded fingerprint for relPath, if any.
+func (m *Manifest) Get(relPath string) (Entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.Entries[relPath]
+	return e, ok
+}
+
+// Set records relPath's fingerprint, overwriting any previous entry.
+func (m *Manifest) Set(relPath string, e Entry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Entries[relPath] = e
+}
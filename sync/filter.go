@@ -0,0 +1,90 @@
+package sync
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/moby/patternmatcher"
+)
+
+// filter decides whether a relative path participates in a sync, using
+// Docker/moby patternmatcher semantics for both the include and exclude
+// pattern lists. A nil *filter allows everything.
+type filter struct {
+	include *patternmatcher.PatternMatcher
+	exclude *patternmatcher.PatternMatcher
+}
+
+// newFilter compiles opts' include/exclude patterns. It returns a nil
+// *filter (not an error) when neither list is configured.
+func newFilter(opts Options) (*filter, error) {
+	if len(opts.IncludePatterns) == 0 && len(opts.ExcludePatterns) == 0 {
+		return nil, nil
+	}
+
+	f := &filter{}
+	if len(opts.IncludePatterns) > 0 {
+		pm, err := patternmatcher.New(opts.IncludePatterns)
+		if err != nil {
+			return nil, fmt.Errorf("compiling include patterns: %w", err)
+		}
+		f.include = pm
+	}
+	if len(opts.ExcludePatterns) > 0 {
+		pm, err := patternmatcher.New(opts.ExcludePatterns)
+		if err != nil {
+			return nil, fmt.Errorf("compiling exclude patterns: %w", err)
+		}
+		f.exclude = pm
+	}
+	return f, nil
+}
+
+// excluded reports whether relPath is blocked by the exclude patterns,
+// ignoring include patterns entirely. Directory traversal must gate on
+// this instead of allow: an include pattern like "docs/**" matches
+// "docs/file.txt" but never matches the "docs" segment itself, so
+// pruning a directory on an include miss would stop the walk from ever
+// reaching the files underneath that would have matched. The include
+// gate only makes sense applied to the leaf being copied.
+func (f *filter) excluded(relPath string) (bool, error) {
+	if f == nil || f.exclude == nil || relPath == "." {
+		return false, nil
+	}
+	matched, err := f.exclude.Matches(filepath.ToSlash(relPath))
+	if err != nil {
+		return false, fmt.Errorf("matching exclude patterns: %w", err)
+	}
+	return matched, nil
+}
+
+// allow reports whether the non-directory relPath should be copied. A path
+// must match at least one include pattern (when any are configured) and
+// must not match the exclude patterns. The sync root itself (".") is
+// always allowed.
+func (f *filter) allow(relPath string) (bool, error) {
+	if f == nil || relPath == "." {
+		return true, nil
+	}
+
+	rel := filepath.ToSlash(relPath)
+	if f.exclude != nil {
+		matched, err := f.exclude.Matches(rel)
+		if err != nil {
+			return false, fmt.Errorf("matching exclude patterns: %w", err)
+		}
+		if matched {
+			return false, nil
+		}
+	}
+	if f.include != nil {
+		matched, err := f.include.Matches(rel)
+		if err != nil {
+			return false, fmt.Errorf("matching include patterns: %w", err)
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,41 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// lstat returns lstat-like info for path on fsys: it prefers
+// afero.Lstater.LstatIfPossible so that symlinks are reported as such
+// rather than transparently followed, falling back to a plain Stat on
+// filesystems that don't support it (e.g. afero.MemMapFs, which has no
+// symlinks to begin with).
+func lstat(fsys afero.Fs, path string) (os.FileInfo, error) {
+	if lstater, ok := fsys.(afero.Lstater); ok {
+		info, _, err := lstater.LstatIfPossible(path)
+		return info, err
+	}
+	return fsys.Stat(path)
+}
+
+// readlink resolves a symlink's target on fsys, for filesystems that
+// support it.
+func readlink(fsys afero.Fs, path string) (string, error) {
+	linker, ok := fsys.(afero.LinkReader)
+	if !ok {
+		return "", fmt.Errorf("%s: filesystem does not support reading symlinks", fsys.Name())
+	}
+	return linker.ReadlinkIfPossible(path)
+}
+
+// symlink creates newname as a link to oldname on fsys, for filesystems
+// that support it.
+func symlink(fsys afero.Fs, oldname, newname string) error {
+	linker, ok := fsys.(afero.Linker)
+	if !ok {
+		return fmt.Errorf("%s: filesystem does not support creating symlinks", fsys.Name())
+	}
+	return linker.SymlinkIfPossible(oldname, newname)
+}
@@ -0,0 +1,36 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// hashBlockSize mirrors Syncthing's block size; it only matters for the
+// buffer io.CopyBuffer reuses while streaming through the hasher.
+const hashBlockSize = 128 * 1024
+
+// hashFile computes a hex-encoded SHA-256 digest of path on fsys.
+func hashFile(fsys afero.Fs, path string) (string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.CopyBuffer(h, f, make([]byte, hashBlockSize)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// mtimeGranularityRisky reports whether info's mtime looks coarse enough
+// (e.g. whole-second resolution, as on FAT) that a size+mtime match isn't
+// trustworthy evidence of unchanged content.
+func mtimeGranularityRisky(info os.FileInfo) bool {
+	return info.ModTime().Nanosecond() == 0
+}
@@ -0,0 +1,109 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Options configures a sync run. The zero value reproduces the historical
+// behavior of Dirs: no filtering and nothing deleted from dst.
+type Options struct {
+	// IncludePatterns, if non-empty, restricts the sync to relative paths
+	// that match at least one pattern. Patterns use Docker/moby
+	// patternmatcher semantics (gitignore-style globs, double-star
+	// recursion, leading "!" negation). Only non-directories are checked
+	// against them; directories are created in dst whether or not they
+	// match.
+	IncludePatterns []string
+	// ExcludePatterns suppresses any relative path that matches at least
+	// one pattern, even if it also matches an include pattern. Excluded
+	// directories are pruned from the walk instead of being recursed into.
+	ExcludePatterns []string
+	// DeleteMissing removes files and directories from dst that are
+	// absent from src. Paths suppressed by ExcludePatterns/IncludePatterns
+	// are never considered orphans, even when DeleteMissing is set.
+	DeleteMissing bool
+	// Symlinks controls how symbolic links in src are handled. The zero
+	// value, SymlinkSkip, matches the historical behavior of Dirs.
+	Symlinks SymlinkMode
+	// ChangeDetection controls how a changed file is distinguished from an
+	// unchanged one. The zero value, SizeModTime, matches the historical
+	// behavior of Dirs.
+	ChangeDetection ChangeDetection
+	// Paranoid forces ChangeDetectionAuto to hash every file whose size and
+	// mtime both match, regardless of whether its mtime granularity looks
+	// risky.
+	Paranoid bool
+	// Parallelism is the number of worker goroutines copying files
+	// concurrently. The zero value defaults to runtime.NumCPU(), clamped
+	// to maxParallelism.
+	Parallelism int
+	// Progress, if set, is called once per file after it has been copied.
+	Progress ProgressFunc
+	// Debounce is how long Watch waits after the last observed filesystem
+	// event before resyncing. The zero value defaults to 500ms. Unused by
+	// Dirs/DirsWithOptions/DirsFS.
+	Debounce time.Duration
+}
+
+// ProgressFunc reports that path (relative to the sync root), total bytes
+// long, has finished copying; bytes is always equal to total, since it is
+// called once per file rather than incrementally as bytes are written. It
+// is called from whichever worker goroutine copied the file, so it must be
+// safe for concurrent use.
+type ProgressFunc func(path string, bytes, total int64)
+
+// ChangeDetection controls how Plan decides that a file has changed.
+type ChangeDetection int
+
+const (
+	// ChangeDetectionSizeModTime compares size and mtime only. It's cheap
+	// but misses edits that preserve both, e.g. restored backups, `touch
+	// -r`, or filesystems with coarse mtime resolution like FAT.
+	ChangeDetectionSizeModTime ChangeDetection = iota
+	// ChangeDetectionHash always hashes both sides' content.
+	ChangeDetectionHash
+	// ChangeDetectionAuto compares size and mtime first; if both match but
+	// the mtime looks too coarse to trust (or Options.Paranoid is set), it
+	// falls back to hashing.
+	ChangeDetectionAuto
+)
+
+// SymlinkMode controls how symbolic links encountered in src are handled.
+type SymlinkMode int
+
+const (
+	// SymlinkSkip ignores symbolic links entirely.
+	SymlinkSkip SymlinkMode = iota
+	// SymlinkPreserve recreates the link in dst via os.Symlink, storing the
+	// same target string rather than copying the referent's contents.
+	SymlinkPreserve
+	// SymlinkFollow stats through the link and copies the referent as a
+	// regular file or directory.
+	SymlinkFollow
+)
+
+// LoadIgnoreFile reads newline-separated exclude patterns from a
+// .dirsyncignore-style file: blank lines and lines starting with '#' are
+// ignored. A missing file is not an error; it yields no patterns.
+func LoadIgnoreFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading ignore file: %w", err)
+	}
+
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, nil
+}
@@ -0,0 +1,581 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"dirsync/internal/safepath"
+	"dirsync/manifest"
+
+	"github.com/spf13/afero"
+)
+
+// ActionKind classifies a single planned Action.
+type ActionKind int
+
+const (
+	// ActionCreate means Path doesn't exist in dst yet.
+	ActionCreate ActionKind = iota
+	// ActionUpdate means Path exists in dst but doesn't match src.
+	ActionUpdate
+	// ActionDelete means Path exists only in dst; Apply removes it when
+	// Options.DeleteMissing is set (Plan only ever emits ActionDelete
+	// entries when it is).
+	ActionDelete
+	// ActionSkip means Path was left alone: already up to date, excluded
+	// by a pattern, or a symlink under SymlinkSkip.
+	ActionSkip
+)
+
+// String returns the lowercase name used in Plan's human-readable output.
+func (k ActionKind) String() string {
+	switch k {
+	case ActionCreate:
+		return "create"
+	case ActionUpdate:
+		return "update"
+	case ActionDelete:
+		return "delete"
+	case ActionSkip:
+		return "skip"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalJSON renders an ActionKind as its String() name (e.g. "create")
+// rather than the underlying int, so `-dry-run=json` output is
+// self-describing.
+func (k ActionKind) MarshalJSON() ([]byte, error) {
+	return json.Marshal(k.String())
+}
+
+// Action is a single entry in a Plan: either a change Apply will make to
+// dst, or the reason a path was left alone. Path is relative to the sync
+// root.
+type Action struct {
+	Kind   ActionKind
+	Path   string
+	Reason string
+	IsDir  bool
+
+	srcPath, dstPath string
+	info             os.FileInfo // srcFS info for Create/Update
+	dstInfo          os.FileInfo // pre-existing dstFS info, if any, captured at plan time
+	isSymlink        bool
+}
+
+// Plan is the full set of actions Apply would take to bring DstDir in
+// line with SrcDir, computed by PlanDirs/PlanFS without mutating either tree.
+type Plan struct {
+	SrcDir, DstDir string
+	Opts           Options
+	Actions        []Action
+
+	srcFS, dstFS afero.Fs
+	dstSnapshot  map[string]os.FileInfo
+	manifest     *manifest.Manifest // hash fingerprints confirmed while planning, carried into Apply
+}
+
+// PlanDirs is like PlanFS but operates on real OS directories.
+func PlanDirs(srcDir, dstDir string, opts Options) (*Plan, error) {
+	return PlanFS(afero.NewOsFs(), afero.NewOsFs(), srcDir, dstDir, opts)
+}
+
+// PlanFS walks srcDir and dstDir (through srcFS/dstFS) and returns the
+// set of actions Apply would take to bring dstDir in line with srcDir.
+// Neither tree is modified; dstDir isn't even required to exist yet.
+func PlanFS(srcFS, dstFS afero.Fs, srcDir, dstDir string, opts Options) (*Plan, error) {
+	f, err := newFilter(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var m *manifest.Manifest
+	if opts.ChangeDetection != ChangeDetectionSizeModTime {
+		m, err = manifest.Load(dstFS, dstDir)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		m = &manifest.Manifest{Entries: make(map[string]manifest.Entry)}
+	}
+
+	plan := &Plan{
+		SrcDir: srcDir,
+		DstDir: dstDir,
+		Opts:   opts,
+		srcFS:  srcFS,
+		dstFS:  dstFS,
+	}
+
+	dstFiles := make(map[string]os.FileInfo)
+	if _, err := dstFS.Stat(dstDir); err == nil {
+		err = afero.Walk(dstFS, dstDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == dstDir {
+				return nil
+			}
+			relPath, err := filepath.Rel(dstDir, path)
+			if err != nil {
+				return err
+			}
+			if relPath == manifest.FileName {
+				return nil
+			}
+			if info.IsDir() {
+				excluded, err := f.excluded(relPath)
+				if err != nil {
+					return err
+				}
+				if excluded {
+					return filepath.SkipDir
+				}
+				dstFiles[relPath] = info
+				return nil
+			}
+			allowed, err := f.allow(relPath)
+			if err != nil {
+				return err
+			}
+			if !allowed {
+				return nil
+			}
+			dstFiles[relPath] = info
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error walking destination folder: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("stating destination folder: %w", err)
+	}
+
+	err = afero.Walk(srcFS, srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("error walking source folder: %w", err)
+		}
+		if path == srcDir {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		if relPath == manifest.FileName {
+			return nil
+		}
+
+		// Directories are gated on exclude patterns only: an include
+		// pattern like "docs/**" matches "docs/file.txt" but never the
+		// "docs" segment itself, so pruning a directory on an include
+		// miss would stop the walk before it ever reached a file that
+		// would have matched. The include gate applies to the leaf being
+		// copied, via the allow() check below.
+		if info.IsDir() {
+			excluded, err := f.excluded(relPath)
+			if err != nil {
+				return err
+			}
+			if excluded {
+				delete(dstFiles, relPath)
+				plan.Actions = append(plan.Actions, Action{Kind: ActionSkip, Path: relPath, Reason: "excluded by pattern", IsDir: true})
+				return filepath.SkipDir
+			}
+
+			dstPath, err := safepath.Join(dstFS, dstDir, relPath)
+			if err != nil {
+				return fmt.Errorf("resolving destination path for %s: %w", relPath, err)
+			}
+
+			existingInfo, exists := dstFiles[relPath]
+			delete(dstFiles, relPath)
+			if !exists {
+				plan.Actions = append(plan.Actions, Action{Kind: ActionCreate, Path: relPath, Reason: "new directory", IsDir: true, dstPath: dstPath})
+			} else if !existingInfo.IsDir() {
+				plan.Actions = append(plan.Actions, Action{Kind: ActionCreate, Path: relPath, Reason: "replacing non-directory with a directory", IsDir: true, dstPath: dstPath, dstInfo: existingInfo})
+			}
+			return nil
+		}
+
+		allowed, err := f.allow(relPath)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			delete(dstFiles, relPath)
+			plan.Actions = append(plan.Actions, Action{Kind: ActionSkip, Path: relPath, Reason: "excluded by pattern"})
+			return nil
+		}
+
+		dstPath, err := safepath.Join(dstFS, dstDir, relPath)
+		if err != nil {
+			return fmt.Errorf("resolving destination path for %s: %w", relPath, err)
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return planSymlink(srcFS, dstFS, srcDir, path, dstPath, relPath, opts, dstFiles, m, plan)
+		}
+
+		dstInfo, exists := dstFiles[relPath]
+		delete(dstFiles, relPath)
+
+		if !exists {
+			plan.Actions = append(plan.Actions, Action{Kind: ActionCreate, Path: relPath, Reason: "new file", srcPath: path, dstPath: dstPath, info: info})
+			return nil
+		}
+
+		update, reason, err := decideUpdate(srcFS, dstFS, path, dstPath, relPath, info, dstInfo, opts, m)
+		if err != nil {
+			return err
+		}
+		if !update {
+			plan.Actions = append(plan.Actions, Action{Kind: ActionSkip, Path: relPath, Reason: "unchanged"})
+			return nil
+		}
+		plan.Actions = append(plan.Actions, Action{Kind: ActionUpdate, Path: relPath, Reason: reason, srcPath: path, dstPath: dstPath, info: info, dstInfo: dstInfo})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DeleteMissing {
+		for relPath, info := range dstFiles {
+			dstPath, err := safepath.Join(dstFS, dstDir, relPath)
+			if err != nil {
+				return nil, fmt.Errorf("resolving destination path for %s: %w", relPath, err)
+			}
+			plan.Actions = append(plan.Actions, Action{Kind: ActionDelete, Path: relPath, Reason: "missing from src", IsDir: info.IsDir(), dstPath: dstPath})
+		}
+	}
+
+	plan.dstSnapshot = dstFiles
+	plan.manifest = m
+	return plan, nil
+}
+
+// decideUpdate reports whether dstInfo must be recreated to match srcInfo,
+// and why. It mirrors opts.ChangeDetection: Hash always verifies by
+// content; Auto trusts size+mtime unless they agree but look untrustworthy
+// (Options.Paranoid, or a risky mtime granularity), in which case it falls
+// back to a hash to rule out a false negative.
+func decideUpdate(srcFS, dstFS afero.Fs, srcPath, dstPath, relPath string, srcInfo, dstInfo os.FileInfo, opts Options, m *manifest.Manifest) (bool, string, error) {
+	srcIsLink := srcInfo.Mode()&os.ModeSymlink != 0
+	dstIsLink := dstInfo.Mode()&os.ModeSymlink != 0
+	if srcIsLink != dstIsLink {
+		return true, "type changed", nil
+	}
+
+	sizeDiffers := srcInfo.Size() != dstInfo.Size()
+	mtimeDiffers := !srcInfo.ModTime().Equal(dstInfo.ModTime())
+	baselineUpdate := sizeDiffers || mtimeDiffers
+
+	verify := func() (bool, string, error) {
+		changed, err := verifyByHash(srcFS, dstFS, srcPath, dstPath, relPath, dstInfo, m)
+		if err != nil {
+			return false, "", err
+		}
+		if !changed {
+			return false, "", nil
+		}
+		return true, "content changed (hash)", nil
+	}
+
+	switch opts.ChangeDetection {
+	case ChangeDetectionHash:
+		return verify()
+	case ChangeDetectionAuto:
+		if !baselineUpdate && (opts.Paranoid || mtimeGranularityRisky(srcInfo)) {
+			return verify()
+		}
+	}
+
+	if !baselineUpdate {
+		return false, "", nil
+	}
+	if sizeDiffers {
+		return true, "size mismatch", nil
+	}
+	return true, "mtime changed", nil
+}
+
+// planSymlink decides the Action(s) for the symlink at path (relative path
+// relPath) without mutating dst. SymlinkPreserve compares link targets via
+// readlink, which is read-only. SymlinkFollow resolves the link's target
+// at plan time (the same safepath.Join containment check Apply would
+// otherwise redo) and, when it's a directory, defers to
+// planFollowedTree to expand the whole subtree into ordinary Create/
+// Update/Skip actions rather than a single opaque entry — otherwise
+// those nested paths are invisible to the delete-missing phase below and
+// get deleted again as soon as Apply writes them. See planFollowedTree's
+// doc comment for why that invisibility matters.
+func planSymlink(srcFS, dstFS afero.Fs, srcDir, path, dstPath, relPath string, opts Options, dstFiles map[string]os.FileInfo, m *manifest.Manifest, plan *Plan) error {
+	if opts.Symlinks == SymlinkSkip {
+		delete(dstFiles, relPath)
+		plan.Actions = append(plan.Actions, Action{Kind: ActionSkip, Path: relPath, Reason: "symlink skipped"})
+		return nil
+	}
+
+	if opts.Symlinks == SymlinkFollow {
+		return planFollowedSymlink(srcFS, dstFS, srcDir, path, dstPath, relPath, opts, dstFiles, m, plan)
+	}
+
+	dstInfo, exists := dstFiles[relPath]
+	delete(dstFiles, relPath)
+
+	if !exists {
+		plan.Actions = append(plan.Actions, Action{Kind: ActionCreate, Path: relPath, Reason: "new symlink", srcPath: path, dstPath: dstPath, isSymlink: true})
+		return nil
+	}
+
+	if dstInfo.Mode()&os.ModeSymlink != 0 {
+		srcTarget, err := readlink(srcFS, path)
+		if err != nil {
+			return fmt.Errorf("reading link %s: %w", path, err)
+		}
+		if dstTarget, err := readlink(dstFS, dstPath); err == nil && dstTarget == srcTarget {
+			plan.Actions = append(plan.Actions, Action{Kind: ActionSkip, Path: relPath, Reason: "symlink up to date"})
+			return nil
+		}
+	}
+
+	plan.Actions = append(plan.Actions, Action{Kind: ActionUpdate, Path: relPath, Reason: "symlink target changed", srcPath: path, dstPath: dstPath, dstInfo: dstInfo, isSymlink: true})
+	return nil
+}
+
+// planFollowedSymlink resolves the symlink at path against srcDir (the
+// same containment-clamping safepath.Join does for a live copy) and plans
+// it as a regular file update when the referent is a file, or expands it
+// via planFollowedTree when the referent is a directory.
+func planFollowedSymlink(srcFS, dstFS afero.Fs, srcDir, path, dstPath, relPath string, opts Options, dstFiles map[string]os.FileInfo, m *manifest.Manifest, plan *Plan) error {
+	target, err := readlink(srcFS, path)
+	if err != nil {
+		return fmt.Errorf("reading link %s: %w", path, err)
+	}
+
+	targetRel := target
+	if !filepath.IsAbs(target) {
+		targetRel = filepath.Join(filepath.Dir(relPath), target)
+	}
+	resolvedTarget, err := safepath.Join(srcFS, srcDir, targetRel)
+	if err != nil {
+		return fmt.Errorf("resolving symlink target for %s: %w", path, err)
+	}
+
+	info, err := srcFS.Stat(resolvedTarget)
+	if err != nil {
+		return fmt.Errorf("stating symlink target %s: %w", path, err)
+	}
+
+	if info.IsDir() {
+		return planFollowedTree(srcFS, dstFS, resolvedTarget, dstPath, relPath, opts, dstFiles, m, plan)
+	}
+
+	dstInfo, exists := dstFiles[relPath]
+	delete(dstFiles, relPath)
+
+	if !exists {
+		plan.Actions = append(plan.Actions, Action{Kind: ActionCreate, Path: relPath, Reason: "new file (followed symlink)", srcPath: resolvedTarget, dstPath: dstPath, info: info})
+		return nil
+	}
+
+	update, reason, err := decideUpdate(srcFS, dstFS, resolvedTarget, dstPath, relPath, info, dstInfo, opts, m)
+	if err != nil {
+		return err
+	}
+	if !update {
+		plan.Actions = append(plan.Actions, Action{Kind: ActionSkip, Path: relPath, Reason: "unchanged"})
+		return nil
+	}
+	plan.Actions = append(plan.Actions, Action{Kind: ActionUpdate, Path: relPath, Reason: "followed symlink: " + reason, srcPath: resolvedTarget, dstPath: dstPath, info: info, dstInfo: dstInfo})
+	return nil
+}
+
+// planFollowedTree walks srcRoot (the already-resolved, already-contained
+// directory a symlink at relPrefix points to) and emits a Create/Update/
+// Skip Action for every entry beneath it, as the main src walk does for a
+// real directory, except that include/exclude patterns are not consulted
+// for entries beneath the link. Apply's delete-missing phase only ever
+// consults plan.Actions, never the filesystem state Apply itself leaves
+// behind, so a followed directory's contents must be fully represented
+// here or they look like orphans (missing from src) on the very next
+// plan/apply cycle that copied them.
+func planFollowedTree(srcFS, dstFS afero.Fs, srcRoot, dstRoot, relPrefix string, opts Options, dstFiles map[string]os.FileInfo, m *manifest.Manifest, plan *Plan) error {
+	return afero.Walk(srcFS, srcRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("error walking followed symlink target %s: %w", srcRoot, err)
+		}
+
+		rel, err := filepath.Rel(srcRoot, path)
+		if err != nil {
+			return err
+		}
+		relPath := relPrefix
+		if rel != "." {
+			relPath = filepath.Join(relPrefix, rel)
+		}
+		dstPath, err := safepath.Join(dstFS, dstRoot, rel)
+		if err != nil {
+			return fmt.Errorf("resolving destination path for %s: %w", relPath, err)
+		}
+
+		if info.IsDir() {
+			existingInfo, exists := dstFiles[relPath]
+			delete(dstFiles, relPath)
+			if rel == "." {
+				// relPath == relPrefix, the symlink's own path: always
+				// needs to exist as a directory in dst, whatever used to
+				// be there (nothing, a file, or a stale symlink).
+				if !exists {
+					plan.Actions = append(plan.Actions, Action{Kind: ActionCreate, Path: relPath, Reason: "new directory (followed symlink)", IsDir: true, dstPath: dstPath})
+				} else if !existingInfo.IsDir() {
+					plan.Actions = append(plan.Actions, Action{Kind: ActionCreate, Path: relPath, Reason: "replacing non-directory with a directory (followed symlink)", IsDir: true, dstPath: dstPath, dstInfo: existingInfo})
+				}
+				return nil
+			}
+			if !exists {
+				plan.Actions = append(plan.Actions, Action{Kind: ActionCreate, Path: relPath, Reason: "new directory", IsDir: true, dstPath: dstPath})
+			} else if !existingInfo.IsDir() {
+				plan.Actions = append(plan.Actions, Action{Kind: ActionCreate, Path: relPath, Reason: "replacing non-directory with a directory", IsDir: true, dstPath: dstPath, dstInfo: existingInfo})
+			}
+			return nil
+		}
+
+		dstInfo, exists := dstFiles[relPath]
+		delete(dstFiles, relPath)
+
+		if !exists {
+			plan.Actions = append(plan.Actions, Action{Kind: ActionCreate, Path: relPath, Reason: "new file", srcPath: path, dstPath: dstPath, info: info})
+			return nil
+		}
+
+		update, reason, err := decideUpdate(srcFS, dstFS, path, dstPath, relPath, info, dstInfo, opts, m)
+		if err != nil {
+			return err
+		}
+		if !update {
+			plan.Actions = append(plan.Actions, Action{Kind: ActionSkip, Path: relPath, Reason: "unchanged"})
+			return nil
+		}
+		plan.Actions = append(plan.Actions, Action{Kind: ActionUpdate, Path: relPath, Reason: reason, srcPath: path, dstPath: dstPath, info: info, dstInfo: dstInfo})
+		return nil
+	})
+}
+
+// String renders the plan as one line per action, e.g.
+// "create new/file.txt  (new file)". Actions are listed in the order
+// PlanFS discovered them, which is a depth-first walk of src
+// followed by any deletes.
+func (p *Plan) String() string {
+	var b strings.Builder
+	for _, a := range p.Actions {
+		fmt.Fprintf(&b, "%-6s %s  (%s)\n", a.Kind, a.Path, a.Reason)
+	}
+	return b.String()
+}
+
+// Apply executes plan, copying and deleting files as needed to bring
+// plan.DstDir in line with plan.SrcDir. Regular file creates/updates are
+// copied by a bounded pool of plan.Opts.Parallelism worker goroutines
+// (default runtime.NumCPU()); directory creation, symlink handling, and
+// deletes stay on the calling goroutine, and deletes only run once every
+// copy has finished.
+func Apply(plan *Plan) error {
+	srcFS, dstFS := plan.srcFS, plan.dstFS
+
+	if err := dstFS.MkdirAll(plan.DstDir, 0o755); err != nil {
+		return fmt.Errorf("creating destination directory: %w", err)
+	}
+
+	// Reuse the manifest PlanFS already loaded (and, for any file it
+	// confirmed unchanged by hash, already updated): reloading from disk
+	// here would discard those plan-time confirmations, so an unmodified
+	// file would need rehashing on every single run regardless of how
+	// recently it was last confirmed.
+	m := plan.manifest
+	if m == nil {
+		m = &manifest.Manifest{Entries: make(map[string]manifest.Entry)}
+	}
+
+	pool := newCopyPool(context.Background(), plan.Opts.Parallelism, srcFS, dstFS, plan.Opts, m)
+
+	dstFiles := make(map[string]os.FileInfo, len(plan.dstSnapshot))
+	for relPath, info := range plan.dstSnapshot {
+		dstFiles[relPath] = info
+	}
+
+	var walkErr error
+	for _, action := range plan.Actions {
+		if err := applyAction(pool, srcFS, dstFS, plan, action, dstFiles); err != nil {
+			walkErr = err
+			break
+		}
+	}
+
+	// Always drain the pool before inspecting its error: jobs submitted
+	// before walkErr must still finish (or fail) before the manifest or
+	// deletes are touched. A worker error takes priority over walkErr,
+	// which in that case is just a pool.submit noticing the pool's
+	// context got cancelled.
+	if poolErr := pool.wait(); poolErr != nil {
+		return poolErr
+	}
+	if walkErr != nil {
+		return walkErr
+	}
+
+	if plan.Opts.ChangeDetection != ChangeDetectionSizeModTime {
+		if err := m.Save(dstFS, plan.DstDir); err != nil {
+			return err
+		}
+	}
+
+	for _, action := range plan.Actions {
+		if action.Kind != ActionDelete {
+			continue
+		}
+		if err := dstFS.RemoveAll(action.dstPath); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", action.dstPath, err)
+		}
+	}
+
+	return nil
+}
+
+// applyAction carries out a single Create/Update Action; Skip and Delete
+// are no-ops here (deletes are applied after every copy has drained, once
+// Apply knows the whole tree synced cleanly).
+func applyAction(pool *copyPool, srcFS, dstFS afero.Fs, plan *Plan, action Action, dstFiles map[string]os.FileInfo) error {
+	switch action.Kind {
+	case ActionSkip, ActionDelete:
+		return nil
+	}
+
+	if action.isSymlink {
+		return syncSymlink(srcFS, dstFS, plan.SrcDir, action.srcPath, action.dstPath, action.Path, plan.Opts, action.dstInfo, dstFiles)
+	}
+
+	if action.IsDir {
+		if action.dstInfo != nil {
+			if err := dstFS.RemoveAll(action.dstPath); err != nil {
+				return fmt.Errorf("replacing %s: %w", action.dstPath, err)
+			}
+		}
+		return dstFS.MkdirAll(action.dstPath, 0o755)
+	}
+
+	if action.dstInfo != nil && action.dstInfo.Mode()&os.ModeSymlink != 0 {
+		if err := dstFS.RemoveAll(action.dstPath); err != nil {
+			return fmt.Errorf("replacing %s: %w", action.dstPath, err)
+		}
+	}
+	return pool.submit(copyJob{path: action.srcPath, dstPath: action.dstPath, relPath: action.Path, info: action.info})
+}
@@ -0,0 +1,132 @@
+package sync_test
+
+import (
+	"testing"
+
+	"dirsync/sync"
+
+	"github.com/spf13/afero"
+)
+
+func actionFor(t *testing.T, plan *sync.Plan, path string) sync.Action {
+	t.Helper()
+	for _, a := range plan.Actions {
+		if a.Path == path {
+			return a
+		}
+	}
+	t.Fatalf("no action planned for %s", path)
+	return sync.Action{}
+}
+
+func TestPlanFSDoesNotMutateDst(t *testing.T) {
+	srcFS := afero.NewMemMapFs()
+	dstFS := afero.NewMemMapFs()
+
+	if err := afero.WriteFile(srcFS, "/src/new.txt", []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(srcFS, "/src/same.txt", []byte("same"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(dstFS, "/dst/same.txt", []byte("same"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(dstFS, "/dst/orphan.txt", []byte("orphan"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	srcInfo, err := srcFS.Stat("/src/same.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstInfo, err := dstFS.Stat("/dst/same.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dstFS.Chtimes("/dst/same.txt", dstInfo.ModTime(), srcInfo.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := sync.PlanFS(srcFS, dstFS, "/src", "/dst", sync.Options{DeleteMissing: true})
+	if err != nil {
+		t.Fatalf("PlanFS failed: %v", err)
+	}
+
+	if exists, _ := afero.Exists(dstFS, "/dst/new.txt"); exists {
+		t.Error("PlanFS must not create /dst/new.txt")
+	}
+	if exists, _ := afero.Exists(dstFS, "/dst/orphan.txt"); !exists {
+		t.Error("PlanFS must not delete /dst/orphan.txt")
+	}
+
+	if a := actionFor(t, plan, "new.txt"); a.Kind != sync.ActionCreate {
+		t.Errorf("new.txt: expected ActionCreate, got %v (%s)", a.Kind, a.Reason)
+	}
+	if a := actionFor(t, plan, "same.txt"); a.Kind != sync.ActionSkip {
+		t.Errorf("same.txt: expected ActionSkip, got %v (%s)", a.Kind, a.Reason)
+	}
+	if a := actionFor(t, plan, "orphan.txt"); a.Kind != sync.ActionDelete {
+		t.Errorf("orphan.txt: expected ActionDelete, got %v (%s)", a.Kind, a.Reason)
+	}
+}
+
+func TestPlanFSExcludedPattern(t *testing.T) {
+	srcFS := afero.NewMemMapFs()
+	dstFS := afero.NewMemMapFs()
+
+	if err := afero.WriteFile(srcFS, "/src/keep.txt", []byte("keep"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(srcFS, "/src/skip.log", []byte("skip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := sync.PlanFS(srcFS, dstFS, "/src", "/dst", sync.Options{ExcludePatterns: []string{"*.log"}})
+	if err != nil {
+		t.Fatalf("PlanFS failed: %v", err)
+	}
+
+	if a := actionFor(t, plan, "skip.log"); a.Kind != sync.ActionSkip || a.Reason != "excluded by pattern" {
+		t.Errorf("skip.log: expected ActionSkip (excluded by pattern), got %v (%s)", a.Kind, a.Reason)
+	}
+	if a := actionFor(t, plan, "keep.txt"); a.Kind != sync.ActionCreate {
+		t.Errorf("keep.txt: expected ActionCreate, got %v (%s)", a.Kind, a.Reason)
+	}
+}
+
+func TestPlanThenApplyMatchesDirsFS(t *testing.T) {
+	srcFS := afero.NewMemMapFs()
+	dstFS := afero.NewMemMapFs()
+
+	if err := afero.WriteFile(srcFS, "/src/file.txt", []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(srcFS, "/src/nested/nested.txt", []byte("nested"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := sync.PlanFS(srcFS, dstFS, "/src", "/dst", sync.Options{})
+	if err != nil {
+		t.Fatalf("PlanFS failed: %v", err)
+	}
+	if err := sync.Apply(plan); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	content, err := afero.ReadFile(dstFS, "/dst/file.txt")
+	if err != nil {
+		t.Fatalf("reading dst file: %v", err)
+	}
+	if string(content) != "content" {
+		t.Errorf("expected dst file content %q, got %q", "content", content)
+	}
+
+	content, err = afero.ReadFile(dstFS, "/dst/nested/nested.txt")
+	if err != nil {
+		t.Fatalf("reading nested dst file: %v", err)
+	}
+	if string(content) != "nested" {
+		t.Errorf("expected nested dst file content %q, got %q", "nested", content)
+	}
+}
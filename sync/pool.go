@@ -0,0 +1,80 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+
+	"dirsync/manifest"
+
+	"github.com/spf13/afero"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxParallelism bounds the worker pool size even when runtime.NumCPU()
+// (or a caller-supplied Options.Parallelism) is very large.
+const maxParallelism = 64
+
+// copyJob is a single file waiting to be copied from src to dst.
+type copyJob struct {
+	path, dstPath, relPath string
+	info                   os.FileInfo
+}
+
+// copyPool copies files across a bounded set of worker goroutines, leaving
+// the walk itself (directory creation, symlink handling, the decision of
+// whether a file needs copying) on a single producer goroutine. The first
+// worker error cancels the pool's context, which the producer watches via
+// submit so it stops dispatching further work.
+type copyPool struct {
+	jobs chan copyJob
+	g    *errgroup.Group
+	ctx  context.Context
+}
+
+func newCopyPool(ctx context.Context, n int, srcFS, dstFS afero.Fs, opts Options, m *manifest.Manifest) *copyPool {
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+	if n > maxParallelism {
+		n = maxParallelism
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	p := &copyPool{jobs: make(chan copyJob), g: g, ctx: gctx}
+
+	for i := 0; i < n; i++ {
+		g.Go(func() error {
+			for job := range p.jobs {
+				if err := copyAndTrack(srcFS, dstFS, job.path, job.dstPath, job.relPath, job.info, opts, m); err != nil {
+					return fmt.Errorf("copying %s: %w", job.path, err)
+				}
+				if opts.Progress != nil {
+					opts.Progress(job.relPath, job.info.Size(), job.info.Size())
+				}
+			}
+			return nil
+		})
+	}
+	return p
+}
+
+// submit enqueues job, blocking until a worker is free. If a worker has
+// already failed, the pool's context is done and submit returns early
+// instead of enqueuing, so the producer can stop walking.
+func (p *copyPool) submit(job copyJob) error {
+	select {
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	case p.jobs <- job:
+		return nil
+	}
+}
+
+// wait closes the job channel and blocks until every worker has drained it,
+// returning the first error any of them reported.
+func (p *copyPool) wait() error {
+	close(p.jobs)
+	return p.g.Wait()
+}
@@ -0,0 +1,156 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"dirsync/internal/safepath"
+
+	"github.com/spf13/afero"
+)
+
+// syncSymlink handles a single src symlink at path (relative path relPath,
+// rooted at srcRoot) according to opts.Symlinks, updating dstPath on dstFS.
+// dstInfo is the pre-existing dst entry at relPath captured at plan time
+// (nil if there was none); dstFiles is only consulted by preserveSymlink's
+// Windows fallback, which may need to walk and replace an entire dst
+// subtree. SymlinkFollow never reaches here: planFollowedSymlink expands a
+// followed link into ordinary Create/Update Actions at plan time, so Apply
+// handles it through the regular file/directory paths in applyAction.
+func syncSymlink(srcFS, dstFS afero.Fs, srcRoot, path, dstPath, relPath string, opts Options, dstInfo os.FileInfo, dstFiles map[string]os.FileInfo) error {
+	switch opts.Symlinks {
+	case SymlinkPreserve:
+		return preserveSymlink(srcFS, dstFS, srcRoot, path, dstPath, relPath, dstInfo, dstFiles)
+	default:
+		return nil // SymlinkSkip
+	}
+}
+
+// preserveSymlink recreates path's link target at dstPath, replacing
+// whatever is currently there (file, directory, or a link with a stale
+// target) if needed. It works even when the link is dangling. dstInfo is
+// the pre-existing dst entry at dstPath, or nil if there wasn't one;
+// srcRoot/relPath/dstFiles are only needed for the Windows fallback below.
+func preserveSymlink(srcFS, dstFS afero.Fs, srcRoot, path, dstPath, relPath string, dstInfo os.FileInfo, dstFiles map[string]os.FileInfo) error {
+	target, err := readlink(srcFS, path)
+	if err != nil {
+		return fmt.Errorf("reading link %s: %w", path, err)
+	}
+
+	if dstInfo != nil {
+		if dstInfo.Mode()&os.ModeSymlink != 0 {
+			if existingTarget, err := readlink(dstFS, dstPath); err == nil && existingTarget == target {
+				return nil // already up to date
+			}
+		}
+		if err := dstFS.RemoveAll(dstPath); err != nil {
+			return fmt.Errorf("replacing %s with a symlink: %w", dstPath, err)
+		}
+	}
+
+	if err := dstFS.MkdirAll(filepath.Dir(dstPath), 0o755); err != nil {
+		return err
+	}
+
+	if err := symlink(dstFS, target, dstPath); err != nil {
+		if runtime.GOOS == "windows" {
+			// Creating a symlink on Windows requires SeCreateSymbolicLinkPrivilege
+			// or developer mode; fall back to copying the referent rather than
+			// failing the whole sync.
+			return followSymlink(srcFS, dstFS, srcRoot, path, dstPath, relPath, nil, dstFiles)
+		}
+		return fmt.Errorf("creating symlink %s: %w", dstPath, err)
+	}
+	return nil
+}
+
+// followSymlink stats through path and copies the referent into dstPath as
+// a regular file or directory tree. The target is resolved via
+// safepath.Join against srcRoot, so a link pointing outside src (whether
+// via ".." or an absolute target like "/etc") is clamped to stay inside
+// it rather than followed off the sync root. dstInfo is the pre-existing
+// dst entry at dstPath, or nil if there wasn't one; it's only meaningful
+// when the referent turns out to be a regular file, since a followed
+// directory is reconciled entry-by-entry by copyTree instead.
+//
+// This is reached only from preserveSymlink's Windows privilege fallback
+// now: normal SymlinkFollow planning is handled by planFollowedSymlink,
+// which expands a followed link into plan-time Actions instead of copying
+// here directly, so those nested paths are visible to Apply's
+// delete-missing phase. See planFollowedTree's doc comment.
+func followSymlink(srcFS, dstFS afero.Fs, srcRoot, path, dstPath, relPath string, dstInfo os.FileInfo, dstFiles map[string]os.FileInfo) error {
+	target, err := readlink(srcFS, path)
+	if err != nil {
+		return fmt.Errorf("reading link %s: %w", path, err)
+	}
+
+	targetRel := target
+	if !filepath.IsAbs(target) {
+		targetRel = filepath.Join(filepath.Dir(relPath), target)
+	}
+	resolvedTarget, err := safepath.Join(srcFS, srcRoot, targetRel)
+	if err != nil {
+		return fmt.Errorf("resolving symlink target for %s: %w", path, err)
+	}
+
+	info, err := srcFS.Stat(resolvedTarget)
+	if err != nil {
+		return fmt.Errorf("stating symlink target %s: %w", path, err)
+	}
+
+	if info.IsDir() {
+		return copyTree(srcFS, dstFS, resolvedTarget, dstPath, relPath, dstFiles)
+	}
+
+	if dstInfo != nil && dstInfo.Mode()&os.ModeSymlink != 0 {
+		if err := dstFS.RemoveAll(dstPath); err != nil {
+			return fmt.Errorf("replacing symlink %s: %w", dstPath, err)
+		}
+		dstInfo = nil
+	}
+	if dstInfo != nil && info.Size() == dstInfo.Size() && info.ModTime().Equal(dstInfo.ModTime()) {
+		return nil
+	}
+	return copyFile(srcFS, dstFS, resolvedTarget, dstPath)
+}
+
+// copyTree copies every entry under srcRoot (on srcFS) into dstRoot (on
+// dstFS). Each visited path (relative to the overall sync root, prefixed
+// with relPrefix) is looked up in dstFiles, so that a regular file whose
+// size and mtime already match is not copied again, and is then removed
+// from dstFiles.
+func copyTree(srcFS, dstFS afero.Fs, srcRoot, dstRoot, relPrefix string, dstFiles map[string]os.FileInfo) error {
+	return afero.Walk(srcFS, srcRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(srcRoot, path)
+		if err != nil {
+			return err
+		}
+		destRel := relPrefix
+		if rel != "." {
+			destRel = filepath.Join(relPrefix, rel)
+		}
+		destPath, err := safepath.Join(dstFS, dstRoot, rel)
+		if err != nil {
+			return fmt.Errorf("resolving destination path for %s: %w", rel, err)
+		}
+
+		existing, exists := dstFiles[destRel]
+		delete(dstFiles, destRel)
+
+		if info.IsDir() {
+			return dstFS.MkdirAll(destPath, 0o755)
+		}
+
+		if exists && existing.Mode()&os.ModeSymlink == 0 &&
+			info.Size() == existing.Size() && info.ModTime().Equal(existing.ModTime()) {
+			return nil
+		}
+		return copyFile(srcFS, dstFS, path, destPath)
+	})
+}
@@ -1,11 +1,17 @@
 package sync
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"time"
+
+	"dirsync/manifest"
+
+	"github.com/spf13/afero"
 )
 
 // Dirs synchronizes the contents of the source directory (srcDir) with the
@@ -21,123 +27,134 @@ import (
 //
 // Returns an error if synchronization fails for any reason.
 func Dirs(srcDir, dstDir string, deleteMissing bool) error {
-	if err := os.MkdirAll(dstDir, 0o755); err != nil {
-		return fmt.Errorf("creating destination directory: %w", err)
-	}
+	return DirsWithOptions(srcDir, dstDir, Options{DeleteMissing: deleteMissing})
+}
 
-	dstFiles := make(map[string]os.FileInfo)
+// DirsWithOptions is like Dirs but accepts a full Options struct, including
+// gitignore-style include/exclude filtering. Excluded subtrees are pruned
+// from the walk rather than descended into, and excluded dst paths are
+// never treated as orphans even when opts.DeleteMissing is set.
+func DirsWithOptions(srcDir, dstDir string, opts Options) error {
+	return DirsFS(afero.NewOsFs(), afero.NewOsFs(), srcDir, dstDir, opts)
+}
 
-	// Walk through the destination directory to collect all files and directories
-	err := filepath.Walk(dstDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if path == dstDir {
-			return nil
-		}
-		relPath, err := filepath.Rel(dstDir, path)
-		if err != nil {
-			return err
-		}
-		dstFiles[relPath] = info
-		return nil
-	})
+// DirsFS is like DirsWithOptions but operates on srcDir/dstDir through the
+// given afero filesystems rather than the OS directly. This allows syncing
+// between an OS directory and an in-memory fs, a tar/zip-backed fs, or a
+// remote (S3/WebDAV) afero adapter. SymlinkPreserve/SymlinkFollow require
+// the underlying filesystems to implement afero's optional Linker/
+// LinkReader interfaces; filesystems that don't (e.g. afero.MemMapFs) will
+// error if a symlink is encountered under those modes.
+//
+// DirsFS is PlanFS followed by Apply; call them separately to inspect or
+// log the plan (e.g. for a dry run) before committing to it.
+func DirsFS(srcFS, dstFS afero.Fs, srcDir, dstDir string, opts Options) error {
+	plan, err := PlanFS(srcFS, dstFS, srcDir, dstDir, opts)
 	if err != nil {
-		return fmt.Errorf("error walking destination folder: %w", err)
+		return err
 	}
+	return Apply(plan)
+}
 
-	// Walk through the source directory to synchronize contents
-	err = filepath.WalkDir(srcDir, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return fmt.Errorf("error walking source folder: %w", err)
-		}
-		if d.Type()&os.ModeSymlink != 0 {
-			return nil // Skip symbolic links
-		}
-
-		relPath, err := filepath.Rel(srcDir, path)
-		if err != nil {
-			return err
-		}
-		dstPath := filepath.Join(dstDir, relPath)
+// copyAndTrack copies path to dstPath and, unless opts.ChangeDetection is
+// the zero-cost SizeModTime mode, records the copied file's fingerprint in
+// m so a later run can verify it by hash without rereading it.
+func copyAndTrack(srcFS, dstFS afero.Fs, path, dstPath, relPath string, info os.FileInfo, opts Options, m *manifest.Manifest) error {
+	if opts.ChangeDetection == ChangeDetectionSizeModTime {
+		return copyFile(srcFS, dstFS, path, dstPath)
+	}
+	hash, err := copyFileHashed(srcFS, dstFS, path, dstPath)
+	if err != nil {
+		return err
+	}
+	m.Set(relPath, manifest.Entry{Size: info.Size(), ModTime: info.ModTime(), Hash: hash})
+	return nil
+}
 
-		if d.IsDir() {
-			return os.MkdirAll(dstPath, 0o755)
-		}
+// verifyByHash compares path's content against dstPath's by hash rather
+// than size/mtime. When m already holds a fingerprint for relPath matching
+// dstInfo's current size and mtime, dstPath's hash is read from the
+// manifest instead of being recomputed. Whenever the hashes match, the
+// manifest is updated with the confirmed fingerprint, so an unmodified dst
+// file never needs rehashing on the next run; path itself is hashed on
+// every call.
+func verifyByHash(srcFS, dstFS afero.Fs, path, dstPath, relPath string, dstInfo os.FileInfo, m *manifest.Manifest) (bool, error) {
+	srcHash, err := hashFile(srcFS, path)
+	if err != nil {
+		return false, fmt.Errorf("hashing %s: %w", path, err)
+	}
 
-		srcInfo, err := d.Info()
+	dstHash := ""
+	if entry, ok := m.Get(relPath); ok && entry.Size == dstInfo.Size() && entry.ModTime.Equal(dstInfo.ModTime()) {
+		dstHash = entry.Hash
+	} else {
+		dstHash, err = hashFile(dstFS, dstPath)
 		if err != nil {
-			return err
-		}
-
-		dstInfo, exists := dstFiles[relPath]
-		delete(dstFiles, relPath)
-
-		if exists {
-			if needsUpdate(srcInfo, dstInfo) {
-				return copyFile(path, dstPath)
-			}
-		} else {
-			return copyFile(path, dstPath)
+			return false, fmt.Errorf("hashing %s: %w", dstPath, err)
 		}
-		return nil
-	})
-	if err != nil {
-		return err
 	}
 
-	if deleteMissing {
-		// Delete files and directories in the destination that are not in the source
-		for relPath, info := range dstFiles {
-			dstPath := filepath.Join(dstDir, relPath)
-			if err := os.RemoveAll(dstPath); err != nil {
-				return fmt.Errorf("failed to delete %s: %w", dstPath, err)
-			}
-			// Ensure directories are deleted properly
-			if info.IsDir() {
-				if err := os.RemoveAll(dstPath); err != nil {
-					return fmt.Errorf("failed to delete directory %s: %w", dstPath, err)
-				}
-			}
-		}
+	if srcHash != dstHash {
+		return true, nil
 	}
+	m.Set(relPath, manifest.Entry{Size: dstInfo.Size(), ModTime: dstInfo.ModTime(), Hash: dstHash})
+	return false, nil
+}
 
-	return nil
+func copyFile(srcFS, dstFS afero.Fs, src, dst string) error {
+	_, err := copyFileTee(srcFS, dstFS, src, dst, nil)
+	return err
 }
 
-func copyFile(src, dst string) error {
-	srcFile, err := os.Open(src)
+// copyFileHashed is like copyFile but also returns a hex-encoded SHA-256
+// digest of the bytes copied, computed in the same read pass so that
+// hashing a freshly-copied file never costs a second pass over its
+// content.
+func copyFileHashed(srcFS, dstFS afero.Fs, src, dst string) (string, error) {
+	h := sha256.New()
+	if _, err := copyFileTee(srcFS, dstFS, src, dst, h); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copyFileTee copies src to dst, also writing every byte to tee when it is
+// non-nil.
+func copyFileTee(srcFS, dstFS afero.Fs, src, dst string, tee io.Writer) (int64, error) {
+	srcFile, err := srcFS.Open(src)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer srcFile.Close()
 
-	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
-		return err
+	if err := dstFS.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return 0, err
 	}
 
-	dstFile, err := os.Create(dst)
+	dstFile, err := dstFS.Create(dst)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer dstFile.Close()
 
-	if _, err = io.Copy(dstFile, srcFile); err != nil {
-		return err
+	w := io.Writer(dstFile)
+	if tee != nil {
+		w = io.MultiWriter(dstFile, tee)
 	}
 
-	srcInfo, err := os.Stat(src)
+	n, err := io.Copy(w, srcFile)
 	if err != nil {
-		return err
+		return n, err
 	}
 
-	if err := os.Chtimes(dst, time.Now(), srcInfo.ModTime()); err != nil {
-		return err
+	srcInfo, err := srcFS.Stat(src)
+	if err != nil {
+		return n, err
 	}
 
-	return os.Chmod(dst, srcInfo.Mode())
-}
+	if err := dstFS.Chtimes(dst, time.Now(), srcInfo.ModTime()); err != nil {
+		return n, err
+	}
 
-func needsUpdate(src, dst os.FileInfo) bool {
-	return src.Size() != dst.Size() || !src.ModTime().Equal(dst.ModTime())
+	return n, dstFS.Chmod(dst, srcInfo.Mode())
 }
@@ -1,12 +1,17 @@
 package sync_test
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	stdsync "sync"
 	"testing"
 
+	"dirsync/manifest"
 	"dirsync/sync"
+
+	"github.com/spf13/afero"
 )
 
 type check func(srcDir string, dstDir string, err error, t *testing.T)
@@ -317,3 +322,617 @@ func TestSync(t *testing.T) {
 		})
 	}
 }
+
+func TestDirsWithOptionsChangeDetection(t *testing.T) {
+	t.Run("hash detects a content change that preserves size and mtime", func(t *testing.T) {
+		srcDir, err := os.MkdirTemp("", "src")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dstDir, err := os.MkdirTemp("", "dst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(srcDir)
+		defer os.RemoveAll(dstDir)
+
+		srcFile := filepath.Join(srcDir, "file.txt")
+		if err := os.WriteFile(srcFile, []byte("aaaaaaaaaa"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		opts := sync.Options{ChangeDetection: sync.ChangeDetectionHash}
+		if err := sync.DirsWithOptions(srcDir, dstDir, opts); err != nil {
+			t.Fatalf("initial sync: %v", err)
+		}
+
+		info, err := os.Stat(srcFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(srcFile, []byte("bbbbbbbbbb"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// Same size as before; force the same mtime so a size+mtime check
+		// alone would wrongly call this file unchanged.
+		if err := os.Chtimes(srcFile, info.ModTime(), info.ModTime()); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := sync.DirsWithOptions(srcDir, dstDir, opts); err != nil {
+			t.Fatalf("second sync: %v", err)
+		}
+
+		content, err := os.ReadFile(filepath.Join(dstDir, "file.txt"))
+		if err != nil {
+			t.Fatalf("reading dst file: %v", err)
+		}
+		if string(content) != "bbbbbbbbbb" {
+			t.Errorf("expected dst file to pick up the content change, got %q", content)
+		}
+	})
+
+	t.Run("auto mode writes a sidecar manifest across repeated syncs", func(t *testing.T) {
+		srcDir, err := os.MkdirTemp("", "src")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dstDir, err := os.MkdirTemp("", "dst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(srcDir)
+		defer os.RemoveAll(dstDir)
+
+		if err := os.WriteFile(filepath.Join(srcDir, "file.txt"), []byte("content"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		opts := sync.Options{ChangeDetection: sync.ChangeDetectionAuto}
+		if err := sync.DirsWithOptions(srcDir, dstDir, opts); err != nil {
+			t.Fatalf("initial sync: %v", err)
+		}
+		if err := sync.DirsWithOptions(srcDir, dstDir, opts); err != nil {
+			t.Fatalf("second sync: %v", err)
+		}
+
+		if _, err := os.Stat(filepath.Join(dstDir, ".dirsync-state.json")); err != nil {
+			t.Errorf("expected a sidecar manifest to be written: %v", err)
+		}
+	})
+
+	t.Run("a file confirmed unchanged at plan time is still recorded in the manifest", func(t *testing.T) {
+		srcDir, err := os.MkdirTemp("", "src")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dstDir, err := os.MkdirTemp("", "dst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(srcDir)
+		defer os.RemoveAll(dstDir)
+
+		// file.txt already matches byte-for-byte in both trees, so Apply
+		// never copies it; its fingerprint can only reach the saved
+		// manifest if PlanFS's hash confirmation survives into Apply.
+		if err := os.WriteFile(filepath.Join(srcDir, "file.txt"), []byte("content"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dstDir, "file.txt"), []byte("content"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		opts := sync.Options{ChangeDetection: sync.ChangeDetectionHash}
+		if err := sync.DirsWithOptions(srcDir, dstDir, opts); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+
+		m, err := manifest.Load(afero.NewOsFs(), dstDir)
+		if err != nil {
+			t.Fatalf("loading manifest: %v", err)
+		}
+		entry, ok := m.Get("file.txt")
+		if !ok || entry.Hash == "" {
+			t.Errorf("expected file.txt's plan-time hash confirmation to be persisted in the manifest, got %+v (ok=%v)", entry, ok)
+		}
+	})
+}
+
+func TestDirsFSInMemory(t *testing.T) {
+	srcFS := afero.NewMemMapFs()
+	dstFS := afero.NewMemMapFs()
+
+	if err := afero.WriteFile(srcFS, "/src/file.txt", []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(srcFS, "/src/nested/nested.txt", []byte("nested"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sync.DirsFS(srcFS, dstFS, "/src", "/dst", sync.Options{}); err != nil {
+		t.Fatalf("DirsFS failed: %v", err)
+	}
+
+	content, err := afero.ReadFile(dstFS, "/dst/file.txt")
+	if err != nil {
+		t.Fatalf("reading dst file: %v", err)
+	}
+	if string(content) != "content" {
+		t.Errorf("expected dst file content %q, got %q", "content", content)
+	}
+
+	content, err = afero.ReadFile(dstFS, "/dst/nested/nested.txt")
+	if err != nil {
+		t.Fatalf("reading nested dst file: %v", err)
+	}
+	if string(content) != "nested" {
+		t.Errorf("expected nested dst file content %q, got %q", "nested", content)
+	}
+}
+
+func TestDirsWithOptionsParallelism(t *testing.T) {
+	srcFS := afero.NewMemMapFs()
+	dstFS := afero.NewMemMapFs()
+
+	const numFiles = 50
+	for i := 0; i < numFiles; i++ {
+		name := fmt.Sprintf("/src/file%d.txt", i)
+		if err := afero.WriteFile(srcFS, name, []byte(fmt.Sprintf("content %d", i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu stdsync.Mutex
+	seen := make(map[string]bool)
+	opts := sync.Options{
+		Parallelism: 4,
+		Progress: func(path string, bytes, total int64) {
+			mu.Lock()
+			defer mu.Unlock()
+			seen[path] = true
+		},
+	}
+
+	if err := sync.DirsFS(srcFS, dstFS, "/src", "/dst", opts); err != nil {
+		t.Fatalf("DirsFS failed: %v", err)
+	}
+
+	for i := 0; i < numFiles; i++ {
+		name := fmt.Sprintf("file%d.txt", i)
+		content, err := afero.ReadFile(dstFS, filepath.Join("/dst", name))
+		if err != nil {
+			t.Fatalf("reading dst file %s: %v", name, err)
+		}
+		if string(content) != fmt.Sprintf("content %d", i) {
+			t.Errorf("dst file %s: expected %q, got %q", name, fmt.Sprintf("content %d", i), content)
+		}
+		if !seen[name] {
+			t.Errorf("expected Progress to have been called for %s", name)
+		}
+	}
+}
+
+func TestDirsWithOptionsFiltering(t *testing.T) {
+	testcases := []struct {
+		name   string
+		opts   sync.Options
+		setup  func() (string, string, error)
+		checks []check
+	}{
+		{
+			name: "exclude pattern prunes a subtree",
+			opts: sync.Options{ExcludePatterns: []string{"vendor"}},
+			setup: func() (string, string, error) {
+				srcDir, err := os.MkdirTemp("", "src")
+				if err != nil {
+					return "", "", err
+				}
+				dstDir, err := os.MkdirTemp("", "dst")
+				if err != nil {
+					return "", "", err
+				}
+				if err := os.MkdirAll(filepath.Join(srcDir, "vendor"), 0o755); err != nil {
+					return "", "", err
+				}
+				if err := os.WriteFile(filepath.Join(srcDir, "vendor", "lib.go"), []byte("lib"), 0o644); err != nil {
+					return "", "", err
+				}
+				if err := os.WriteFile(filepath.Join(srcDir, "main.go"), []byte("main"), 0o644); err != nil {
+					return "", "", err
+				}
+				return srcDir, dstDir, nil
+			},
+			checks: []check{
+				hasNoError(),
+				assertFileExistsInDst("main.go"),
+				assertFileMissingInDst("vendor/lib.go"),
+			},
+		},
+		{
+			name: "include pattern restricts the sync to matching paths",
+			opts: sync.Options{IncludePatterns: []string{"*.go"}},
+			setup: func() (string, string, error) {
+				srcDir, err := os.MkdirTemp("", "src")
+				if err != nil {
+					return "", "", err
+				}
+				dstDir, err := os.MkdirTemp("", "dst")
+				if err != nil {
+					return "", "", err
+				}
+				if err := os.WriteFile(filepath.Join(srcDir, "main.go"), []byte("main"), 0o644); err != nil {
+					return "", "", err
+				}
+				if err := os.WriteFile(filepath.Join(srcDir, "README.md"), []byte("readme"), 0o644); err != nil {
+					return "", "", err
+				}
+				return srcDir, dstDir, nil
+			},
+			checks: []check{
+				hasNoError(),
+				assertFileExistsInDst("main.go"),
+				assertFileMissingInDst("README.md"),
+			},
+		},
+		{
+			name: "directory-anchored include pattern still reaches nested files",
+			opts: sync.Options{IncludePatterns: []string{"docs/**"}},
+			setup: func() (string, string, error) {
+				srcDir, err := os.MkdirTemp("", "src")
+				if err != nil {
+					return "", "", err
+				}
+				dstDir, err := os.MkdirTemp("", "dst")
+				if err != nil {
+					return "", "", err
+				}
+				if err := os.MkdirAll(filepath.Join(srcDir, "docs"), 0o755); err != nil {
+					return "", "", err
+				}
+				if err := os.WriteFile(filepath.Join(srcDir, "docs", "guide.txt"), []byte("guide"), 0o644); err != nil {
+					return "", "", err
+				}
+				if err := os.WriteFile(filepath.Join(srcDir, "main.go"), []byte("main"), 0o644); err != nil {
+					return "", "", err
+				}
+				return srcDir, dstDir, nil
+			},
+			checks: []check{
+				hasNoError(),
+				assertFileExistsInDst("docs/guide.txt"),
+				assertFileMissingInDst("main.go"),
+			},
+		},
+		{
+			name: "excluded dst path survives delete-missing",
+			opts: sync.Options{ExcludePatterns: []string{"cache"}, DeleteMissing: true},
+			setup: func() (string, string, error) {
+				srcDir, err := os.MkdirTemp("", "src")
+				if err != nil {
+					return "", "", err
+				}
+				dstDir, err := os.MkdirTemp("", "dst")
+				if err != nil {
+					return "", "", err
+				}
+				if err := os.MkdirAll(filepath.Join(dstDir, "cache"), 0o755); err != nil {
+					return "", "", err
+				}
+				if err := os.WriteFile(filepath.Join(dstDir, "cache", "keep.txt"), []byte("keep"), 0o644); err != nil {
+					return "", "", err
+				}
+				return srcDir, dstDir, nil
+			},
+			checks: []check{
+				hasNoError(),
+				assertFileExistsInDst("cache/keep.txt"),
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			srcDir, dstDir, err := tc.setup()
+			if err != nil {
+				t.Fatalf("Setup failed: %v", err)
+			}
+			defer func() {
+				if err := os.RemoveAll(srcDir); err != nil {
+					t.Errorf("Failed to remove source test dirs: %v\n", err)
+				}
+				if err := os.RemoveAll(dstDir); err != nil {
+					t.Errorf("Failed to remove destination test dirs: %v\n", err)
+				}
+			}()
+
+			err = sync.DirsWithOptions(srcDir, dstDir, tc.opts)
+
+			for _, check := range tc.checks {
+				check(srcDir, dstDir, err, t)
+			}
+		})
+	}
+}
+
+func TestDirsWithOptionsSymlinkTransitions(t *testing.T) {
+	opts := sync.Options{Symlinks: sync.SymlinkPreserve}
+
+	t.Run("file replaced by a symlink", func(t *testing.T) {
+		srcDir, err := os.MkdirTemp("", "src")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dstDir, err := os.MkdirTemp("", "dst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(srcDir)
+		defer os.RemoveAll(dstDir)
+
+		target := filepath.Join(srcDir, "target.txt")
+		if err := os.WriteFile(target, []byte("target"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		entry := filepath.Join(srcDir, "entry")
+		if err := os.WriteFile(entry, []byte("old"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := sync.DirsWithOptions(srcDir, dstDir, opts); err != nil {
+			t.Fatalf("initial sync: %v", err)
+		}
+
+		if err := os.Remove(entry); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, entry); err != nil {
+			t.Fatal(err)
+		}
+		if err := sync.DirsWithOptions(srcDir, dstDir, opts); err != nil {
+			t.Fatalf("second sync: %v", err)
+		}
+
+		info, err := os.Lstat(filepath.Join(dstDir, "entry"))
+		if err != nil {
+			t.Fatalf("lstat dst entry: %v", err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("expected dst entry to become a symlink")
+		}
+	})
+
+	t.Run("symlink replaced by a file", func(t *testing.T) {
+		srcDir, err := os.MkdirTemp("", "src")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dstDir, err := os.MkdirTemp("", "dst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(srcDir)
+		defer os.RemoveAll(dstDir)
+
+		target := filepath.Join(srcDir, "target.txt")
+		if err := os.WriteFile(target, []byte("target"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		entry := filepath.Join(srcDir, "entry")
+		if err := os.Symlink(target, entry); err != nil {
+			t.Fatal(err)
+		}
+		if err := sync.DirsWithOptions(srcDir, dstDir, opts); err != nil {
+			t.Fatalf("initial sync: %v", err)
+		}
+
+		if err := os.Remove(entry); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(entry, []byte("now a real file"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := sync.DirsWithOptions(srcDir, dstDir, opts); err != nil {
+			t.Fatalf("second sync: %v", err)
+		}
+
+		dstEntry := filepath.Join(dstDir, "entry")
+		info, err := os.Lstat(dstEntry)
+		if err != nil {
+			t.Fatalf("lstat dst entry: %v", err)
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			t.Errorf("expected dst entry to become a regular file")
+		}
+		content, err := os.ReadFile(dstEntry)
+		if err != nil {
+			t.Fatalf("reading dst entry: %v", err)
+		}
+		if string(content) != "now a real file" {
+			t.Errorf("expected dst entry content to match src, got %q", content)
+		}
+	})
+
+	t.Run("symlink replaced by a directory", func(t *testing.T) {
+		srcDir, err := os.MkdirTemp("", "src")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dstDir, err := os.MkdirTemp("", "dst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(srcDir)
+		defer os.RemoveAll(dstDir)
+
+		target := filepath.Join(srcDir, "target.txt")
+		if err := os.WriteFile(target, []byte("target"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		entry := filepath.Join(srcDir, "entry")
+		if err := os.Symlink(target, entry); err != nil {
+			t.Fatal(err)
+		}
+		if err := sync.DirsWithOptions(srcDir, dstDir, opts); err != nil {
+			t.Fatalf("initial sync: %v", err)
+		}
+
+		if err := os.Remove(entry); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(entry, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := sync.DirsWithOptions(srcDir, dstDir, opts); err != nil {
+			t.Fatalf("second sync: %v", err)
+		}
+
+		dstEntry := filepath.Join(dstDir, "entry")
+		info, err := os.Lstat(dstEntry)
+		if err != nil {
+			t.Fatalf("lstat dst entry: %v", err)
+		}
+		if !info.IsDir() {
+			t.Errorf("expected dst entry to become a directory")
+		}
+	})
+
+	t.Run("dangling symlink is preserved", func(t *testing.T) {
+		srcDir, err := os.MkdirTemp("", "src")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dstDir, err := os.MkdirTemp("", "dst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(srcDir)
+		defer os.RemoveAll(dstDir)
+
+		entry := filepath.Join(srcDir, "entry")
+		if err := os.Symlink(filepath.Join(srcDir, "does-not-exist"), entry); err != nil {
+			t.Fatal(err)
+		}
+		if err := sync.DirsWithOptions(srcDir, dstDir, opts); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+
+		dstEntry := filepath.Join(dstDir, "entry")
+		info, err := os.Lstat(dstEntry)
+		if err != nil {
+			t.Fatalf("lstat dst entry: %v", err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("expected dangling symlink to be preserved as a symlink")
+		}
+	})
+}
+
+// TestDirsWithOptionsSymlinkFollowContainment mirrors the classic path
+// traversal cases (a ".."-laden relative target, and an absolute target
+// like "/etc") to confirm SymlinkFollow never copies anything from outside
+// srcDir, even when a symlink tries to point there.
+func TestDirsWithOptionsSymlinkFollowContainment(t *testing.T) {
+	opts := sync.Options{Symlinks: sync.SymlinkFollow}
+
+	t.Run("dot-dot escape clamps back into src", func(t *testing.T) {
+		srcDir, err := os.MkdirTemp("", "src")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dstDir, err := os.MkdirTemp("", "dst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(srcDir)
+		defer os.RemoveAll(dstDir)
+
+		if err := os.WriteFile(filepath.Join(srcDir, "real.txt"), []byte("inside src"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(srcDir, "sub"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		// Climbs far more levels than srcDir is deep; a naive resolver
+		// would walk out to the real filesystem root.
+		if err := os.Symlink("../../../../../real.txt", filepath.Join(srcDir, "sub", "link")); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := sync.DirsWithOptions(srcDir, dstDir, opts); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+
+		content, err := os.ReadFile(filepath.Join(dstDir, "sub", "link"))
+		if err != nil {
+			t.Fatalf("reading dst entry: %v", err)
+		}
+		if string(content) != "inside src" {
+			t.Errorf("expected the escape to clamp back to src/real.txt, got %q", content)
+		}
+	})
+
+	t.Run("absolute symlink to /etc is confined to src", func(t *testing.T) {
+		srcDir, err := os.MkdirTemp("", "src")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dstDir, err := os.MkdirTemp("", "dst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(srcDir)
+		defer os.RemoveAll(dstDir)
+
+		if err := os.Symlink("/etc/passwd", filepath.Join(srcDir, "link")); err != nil {
+			t.Fatal(err)
+		}
+
+		// srcDir has no "etc/passwd" of its own, so the absolute target,
+		// re-anchored to srcDir instead of the real filesystem root, must
+		// fail to stat rather than silently leak the host's /etc/passwd.
+		err = sync.DirsWithOptions(srcDir, dstDir, opts)
+		if err == nil {
+			t.Fatal("expected an error resolving a symlink target confined to src")
+		}
+
+		if _, statErr := os.Stat(filepath.Join(dstDir, "link")); !os.IsNotExist(statErr) {
+			t.Errorf("expected dst not to contain the host's /etc/passwd")
+		}
+	})
+}
+
+// TestDirsWithOptionsSymlinkFollowDeleteMissingIdempotent guards against a
+// regression where a followed directory symlink's contents were invisible
+// to the delete-missing pass: a second sync of an unchanged tree must not
+// delete what the first sync just wrote.
+func TestDirsWithOptionsSymlinkFollowDeleteMissingIdempotent(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstDir, err := os.MkdirTemp("", "dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+	defer os.RemoveAll(dstDir)
+
+	if err := os.MkdirAll(filepath.Join(srcDir, "target"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "target", "x.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("target", filepath.Join(srcDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := sync.Options{Symlinks: sync.SymlinkFollow, DeleteMissing: true}
+
+	for i := 0; i < 2; i++ {
+		if err := sync.DirsWithOptions(srcDir, dstDir, opts); err != nil {
+			t.Fatalf("sync #%d: %v", i+1, err)
+		}
+		if _, err := os.Stat(filepath.Join(dstDir, "link", "x.txt")); err != nil {
+			t.Fatalf("after sync #%d: link/x.txt missing: %v", i+1, err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// defaultDebounce is how long Watch waits after the last observed
+// filesystem event before resyncing, when Options.Debounce is unset.
+const defaultDebounce = 500 * time.Millisecond
+
+// fallbackScanInterval is how often Watch falls back to a full resync
+// while degraded: the notifier couldn't register a watch on some
+// subdirectory, or its event queue overflowed and may have dropped events.
+const fallbackScanInterval = 30 * time.Second
+
+// Watch performs an initial full sync via DirsWithOptions and then keeps
+// dstDir synchronized with srcDir by subscribing to fsnotify events on
+// srcDir, until ctx is cancelled. Bursts of events (an editor save, a git
+// checkout) are coalesced into a set of dirty relative paths and flushed
+// together after opts.Debounce (default 500ms) of quiet, producing a
+// single resync pass instead of one per touched file.
+//
+// fsnotify has no recursive watch mode, so Watch registers a watch on
+// every subdirectory individually and adds one for each new subdirectory
+// as it's created. If a subdirectory can't be watched, or the notifier's
+// event queue overflows (reported as an event with Op == 0, meaning some
+// events were dropped), Watch falls back to a periodic full resync every
+// fallbackScanInterval until the next clean event arrives.
+func Watch(ctx context.Context, srcDir, dstDir string, opts Options) error {
+	if err := DirsWithOptions(srcDir, dstDir, opts); err != nil {
+		return fmt.Errorf("initial sync: %w", err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("creating watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	degraded := addWatchesRecursive(watcher, srcDir)
+
+	debounce := opts.Debounce
+	if debounce <= 0 {
+		debounce = defaultDebounce
+	}
+	debounceTimer := time.NewTimer(debounce)
+	stopTimer(debounceTimer)
+
+	fallback := time.NewTicker(fallbackScanInterval)
+	defer fallback.Stop()
+
+	dirty := make(map[string]struct{})
+	flush := func() error {
+		dirty = make(map[string]struct{})
+		return DirsWithOptions(srcDir, dstDir, opts)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == 0 {
+				degraded = true
+			} else {
+				degraded = false
+				if rel, err := filepath.Rel(srcDir, event.Name); err == nil {
+					dirty[rel] = struct{}{}
+				}
+				if event.Op&fsnotify.Create != 0 {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						if !addWatch(watcher, event.Name) {
+							degraded = true
+						}
+					}
+				}
+			}
+			stopTimer(debounceTimer)
+			debounceTimer.Reset(debounce)
+
+		case watchErr, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return fmt.Errorf("watching %s: %w", srcDir, watchErr)
+
+		case <-debounceTimer.C:
+			if len(dirty) > 0 {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+
+		case <-fallback.C:
+			if degraded {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// addWatchesRecursive registers a watch on root and every subdirectory
+// beneath it, returning true if any of them couldn't be watched (the
+// caller should then fall back to periodic full resyncs rather than
+// trusting events alone).
+func addWatchesRecursive(watcher *fsnotify.Watcher, root string) (degraded bool) {
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			degraded = true
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if !addWatch(watcher, path) {
+			degraded = true
+		}
+		return nil
+	})
+	return degraded
+}
+
+func addWatch(watcher *fsnotify.Watcher, path string) bool {
+	return watcher.Add(path) == nil
+}
+
+// stopTimer stops t, draining its channel if it had already fired, so it
+// can be safely Reset afterwards.
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package sync_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dirsync/sync"
+)
+
+func TestWatchResyncsOnChange(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstDir, err := os.MkdirTemp("", "dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+	defer os.RemoveAll(dstDir)
+
+	if err := os.WriteFile(filepath.Join(srcDir, "initial.txt"), []byte("initial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := sync.Options{Debounce: 50 * time.Millisecond}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sync.Watch(ctx, srcDir, dstDir, opts)
+	}()
+
+	// The initial full sync inside Watch races with this write; give it a
+	// moment to complete before adding more work for it to pick up.
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(filepath.Join(srcDir, "added.txt"), []byte("added"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(4 * time.Second)
+	for {
+		if _, err := os.Stat(filepath.Join(dstDir, "added.txt")); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for Watch to pick up the new file")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Watch returned an error: %v", err)
+	}
+}
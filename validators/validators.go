@@ -3,10 +3,18 @@ package validators
 import (
 	"fmt"
 	"os"
+
+	"github.com/spf13/afero"
 )
 
 func ValidateSrcDir(path string) error {
-	info, err := os.Stat(path)
+	return ValidateSrcDirFS(afero.NewOsFs(), path)
+}
+
+// ValidateSrcDirFS is like ValidateSrcDir but checks path on the given
+// afero filesystem instead of the OS directly.
+func ValidateSrcDirFS(fsys afero.Fs, path string) error {
+	info, err := fsys.Stat(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return fmt.Errorf("path does not exist: %w", err)